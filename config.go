@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the top-level shape of the -config YAML file: a set of named
+// sinks, and routes that fan an incoming webhook out to one or more of them.
+type Config struct {
+	Sinks  []SinkConfig  `yaml:"sinks"`
+	Routes []RouteConfig `yaml:"routes"`
+}
+
+// SinkConfig describes one named destination. Exactly one of the
+// type-specific blocks should be set, matching Type.
+type SinkConfig struct {
+	Name    string             `yaml:"name"`
+	Type    string             `yaml:"type"`
+	Signal  *SignalSinkConfig  `yaml:"signal,omitempty"`
+	Slack   *SlackSinkConfig   `yaml:"slack,omitempty"`
+	Matrix  *MatrixSinkConfig  `yaml:"matrix,omitempty"`
+	Webhook *WebhookSinkConfig `yaml:"webhook,omitempty"`
+}
+
+// SignalSinkConfig configures a "signal" sink.
+type SignalSinkConfig struct {
+	APIURL  string `yaml:"api_url"`
+	Phone   string `yaml:"phone"`
+	GroupID string `yaml:"group_id"`
+}
+
+// SlackSinkConfig configures a "slack" sink.
+type SlackSinkConfig struct {
+	WebhookURL string `yaml:"webhook_url"`
+}
+
+// MatrixSinkConfig configures a "matrix" sink.
+type MatrixSinkConfig struct {
+	HomeserverURL string `yaml:"homeserver"`
+	RoomID        string `yaml:"room_id"`
+	AccessToken   string `yaml:"access_token"`
+}
+
+// WebhookSinkConfig configures a generic "webhook" sink.
+type WebhookSinkConfig struct {
+	URL      string `yaml:"url"`
+	Template string `yaml:"template"`
+}
+
+// RouteConfig maps an incoming request's source tag (the path segment after
+// the webhook secret, e.g. "puzzmo-daily" in /{secret}/puzzmo-daily) to the
+// sinks it should fan out to, optionally filtered by a regexp on the
+// message content.
+type RouteConfig struct {
+	Path  string   `yaml:"path"`
+	Sinks []string `yaml:"sinks"`
+	Match string   `yaml:"match"`
+}
+
+// Route is a RouteConfig with its Match regexp pre-compiled.
+type Route struct {
+	Path  string
+	Sinks []string
+	Match *regexp.Regexp
+}
+
+// LoadConfig reads and parses the YAML config file at path.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parsing config file: %w", err)
+	}
+
+	return &cfg, nil
+}
+
+// defaultConfig builds the single-sink, single-route config that reproduces
+// today's behavior from the SIGNAL_* environment variables, for deployments
+// that don't pass -config.
+func defaultConfig() *Config {
+	return &Config{
+		Sinks: []SinkConfig{
+			{
+				Name: "default",
+				Type: "signal",
+				Signal: &SignalSinkConfig{
+					APIURL:  os.Getenv("SIGNAL_API_URL"),
+					Phone:   os.Getenv("SIGNAL_PHONE"),
+					GroupID: os.Getenv("SIGNAL_GROUP_ID"),
+				},
+			},
+		},
+		Routes: []RouteConfig{
+			{Path: "", Sinks: []string{"default"}},
+		},
+	}
+}
+
+// BuildSinks constructs a Sink for every entry in cfg.Sinks, keyed by name.
+func BuildSinks(cfg *Config) (map[string]Sink, error) {
+	sinks := make(map[string]Sink, len(cfg.Sinks))
+
+	for _, sc := range cfg.Sinks {
+		if sc.Name == "" {
+			return nil, fmt.Errorf("sink missing name")
+		}
+
+		switch sc.Type {
+		case "signal":
+			if sc.Signal == nil {
+				return nil, fmt.Errorf("sink %q: missing signal config", sc.Name)
+			}
+			sinks[sc.Name] = &SignalSink{
+				APIURL:  sc.Signal.APIURL,
+				Phone:   sc.Signal.Phone,
+				GroupID: sc.Signal.GroupID,
+			}
+		case "slack":
+			if sc.Slack == nil {
+				return nil, fmt.Errorf("sink %q: missing slack config", sc.Name)
+			}
+			sinks[sc.Name] = &SlackSink{WebhookURL: sc.Slack.WebhookURL}
+		case "matrix":
+			if sc.Matrix == nil {
+				return nil, fmt.Errorf("sink %q: missing matrix config", sc.Name)
+			}
+			sinks[sc.Name] = &MatrixSink{
+				HomeserverURL: sc.Matrix.HomeserverURL,
+				RoomID:        sc.Matrix.RoomID,
+				AccessToken:   sc.Matrix.AccessToken,
+			}
+		case "webhook":
+			if sc.Webhook == nil {
+				return nil, fmt.Errorf("sink %q: missing webhook config", sc.Name)
+			}
+			tmpl, err := template.New(sc.Name).Parse(sc.Webhook.Template)
+			if err != nil {
+				return nil, fmt.Errorf("sink %q: parsing template: %w", sc.Name, err)
+			}
+			sinks[sc.Name] = &WebhookSink{URL: sc.Webhook.URL, Template: tmpl}
+		default:
+			return nil, fmt.Errorf("sink %q: unknown type %q", sc.Name, sc.Type)
+		}
+	}
+
+	return sinks, nil
+}
+
+// BuildRoutes compiles each RouteConfig's Match regexp.
+func BuildRoutes(cfg *Config) ([]Route, error) {
+	routes := make([]Route, 0, len(cfg.Routes))
+
+	for _, rc := range cfg.Routes {
+		route := Route{Path: rc.Path, Sinks: rc.Sinks}
+		if rc.Match != "" {
+			re, err := regexp.Compile(rc.Match)
+			if err != nil {
+				return nil, fmt.Errorf("route %q: compiling match regexp: %w", rc.Path, err)
+			}
+			route.Match = re
+		}
+		routes = append(routes, route)
+	}
+
+	return routes, nil
+}
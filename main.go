@@ -1,8 +1,11 @@
 package main
 
 import (
-	"bytes"
+	"context"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"flag"
@@ -11,8 +14,12 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/huantt/plaintext-extractor"
 	"tailscale.com/tsnet"
@@ -62,35 +69,238 @@ func getWebhookPath() (string, error) {
 		return "", err
 	}
 
-	// Save the new path
-	config := WebhookConfig{Path: path}
-	data, err = json.Marshal(config)
-	if err != nil {
+	if err := saveWebhookPath(path); err != nil {
 		return "", err
 	}
 
-	if err := os.WriteFile(configFile, data, 0600); err != nil {
-		return "", err
+	return path, nil
+}
+
+// saveWebhookPath persists path to webhook_config.json, overwriting any
+// path already there. Used both on first run and by /rotate-secret.
+func saveWebhookPath(path string) error {
+	userConfigDir, err := os.UserConfigDir()
+	if err != nil {
+		return fmt.Errorf("failed to get user config directory: %v", err)
 	}
 
-	return path, nil
+	configDir := filepath.Join(userConfigDir, "puzzmo2signal")
+	if err := os.MkdirAll(configDir, 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %v", err)
+	}
+
+	configFile := filepath.Join(configDir, "webhook_config.json")
+	data, err := json.Marshal(WebhookConfig{Path: path})
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(configFile, data, 0600)
+}
+
+// verifyWebhookSignature checks that signature (as received in the configured
+// header, e.g. "sha256=<hex>") matches HMAC-SHA256(secret, body). Comparison
+// is constant-time to avoid leaking the secret via timing.
+func verifyWebhookSignature(body []byte, signature, secret string) bool {
+	const prefix = "sha256="
+	if !strings.HasPrefix(signature, prefix) {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	expected := prefix + hex.EncodeToString(mac.Sum(nil))
+
+	return hmac.Equal([]byte(signature), []byte(expected))
 }
 
 // DiscordWebhook represents the structure of a Discord webhook payload
 type DiscordWebhook struct {
-	Content string `json:"content"`
-	// Add other fields as needed
+	Content     string              `json:"content"`
+	Embeds      []DiscordEmbed      `json:"embeds"`
+	Attachments []DiscordAttachment `json:"attachments"`
+}
+
+// DiscordEmbedAuthor represents the author block of a Discord embed
+type DiscordEmbedAuthor struct {
+	Name string `json:"name"`
+}
+
+// DiscordEmbedFooter represents the footer block of a Discord embed
+type DiscordEmbedFooter struct {
+	Text string `json:"text"`
+}
+
+// DiscordEmbedField represents a single field in a Discord embed
+type DiscordEmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+// DiscordEmbedImage represents an image or thumbnail block of a Discord embed
+type DiscordEmbedImage struct {
+	URL string `json:"url"`
+}
+
+// DiscordEmbed represents the standard Discord embed shape
+type DiscordEmbed struct {
+	Title       string              `json:"title"`
+	Description string              `json:"description"`
+	URL         string              `json:"url"`
+	Timestamp   string              `json:"timestamp"`
+	Author      DiscordEmbedAuthor  `json:"author"`
+	Fields      []DiscordEmbedField `json:"fields"`
+	Footer      DiscordEmbedFooter  `json:"footer"`
+	Image       DiscordEmbedImage   `json:"image"`
+	Thumbnail   DiscordEmbedImage   `json:"thumbnail"`
+}
+
+// DiscordAttachment represents an entry in a Discord webhook's attachments array
+type DiscordAttachment struct {
+	URL         string `json:"url"`
+	ContentType string `json:"content_type"`
+}
+
+// renderEmbeds turns Discord embeds into a Signal-friendly text block. Each
+// embed becomes an author line (when set), a bold (or plain, if markdown is
+// not preserved) title line with the embed URL appended in parentheses,
+// followed by the description, the fields, and a footer/timestamp line.
+func renderEmbeds(embeds []DiscordEmbed, preserveMarkdown bool) string {
+	var blocks []string
+
+	for _, embed := range embeds {
+		var lines []string
+
+		if embed.Author.Name != "" {
+			lines = append(lines, embed.Author.Name)
+		}
+
+		if embed.Title != "" {
+			title := embed.Title
+			if embed.URL != "" {
+				title = fmt.Sprintf("%s (%s)", title, embed.URL)
+			}
+			if preserveMarkdown {
+				title = "**" + title + "**"
+			}
+			lines = append(lines, title)
+		}
+
+		if embed.Description != "" {
+			lines = append(lines, embed.Description)
+		}
+
+		for _, field := range embed.Fields {
+			if field.Inline {
+				lines = append(lines, fmt.Sprintf("%s — %s", field.Name, field.Value))
+			} else {
+				lines = append(lines, fmt.Sprintf("%s: %s", field.Name, field.Value))
+			}
+		}
+
+		var footerParts []string
+		if embed.Footer.Text != "" {
+			footerParts = append(footerParts, embed.Footer.Text)
+		}
+		if embed.Timestamp != "" {
+			if ts, err := time.Parse(time.RFC3339, embed.Timestamp); err == nil {
+				footerParts = append(footerParts, ts.Format("Jan 2, 2006 3:04 PM MST"))
+			} else {
+				footerParts = append(footerParts, embed.Timestamp)
+			}
+		}
+		if len(footerParts) > 0 {
+			lines = append(lines, strings.Join(footerParts, " • "))
+		}
+
+		if len(lines) > 0 {
+			blocks = append(blocks, strings.Join(lines, "\n"))
+		}
+	}
+
+	return strings.Join(blocks, "\n\n")
 }
 
 // SignalAPIPayload represents the structure of the Signal API request
 type SignalAPIPayload struct {
-	Number     string   `json:"number"`
-	Message    string   `json:"message"`
-	Recipients []string `json:"recipients"`
+	Number            string   `json:"number"`
+	Message           string   `json:"message"`
+	Recipients        []string `json:"recipients"`
+	Base64Attachments []string `json:"base64_attachments,omitempty"`
 }
 
-// Create a handler factory function that takes the flag value
-func makeWebhookHandler(preserveMarkdown bool) http.HandlerFunc {
+const defaultAttachmentMaxBytes = 8 * 1024 * 1024 // 8 MiB
+const defaultAttachmentTimeout = 10 * time.Second
+const defaultAttachmentMIMEAllowlist = "image/"
+
+// attachmentURLs collects the image URLs worth forwarding to Signal from a
+// Discord webhook payload: explicit attachments plus embed image/thumbnail.
+func attachmentURLs(discordPayload DiscordWebhook) []string {
+	var urls []string
+
+	for _, attachment := range discordPayload.Attachments {
+		if attachment.URL != "" {
+			urls = append(urls, attachment.URL)
+		}
+	}
+
+	for _, embed := range discordPayload.Embeds {
+		if embed.Image.URL != "" {
+			urls = append(urls, embed.Image.URL)
+		}
+		if embed.Thumbnail.URL != "" {
+			urls = append(urls, embed.Thumbnail.URL)
+		}
+	}
+
+	return urls
+}
+
+// fetchAttachmentAsDataURL downloads url with client, enforcing maxBytes and
+// the configured MIME allowlist, and returns it as a data: URL suitable for
+// signal-cli-rest-api's base64_attachments field.
+func fetchAttachmentAsDataURL(client *http.Client, url string, maxBytes int64, mimeAllowlist []string) (string, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", fmt.Errorf("fetching attachment: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("attachment fetch returned status %d", resp.StatusCode)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	allowed := false
+	for _, prefix := range mimeAllowlist {
+		if strings.HasPrefix(contentType, prefix) {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return "", fmt.Errorf("attachment content type %q not in allowlist", contentType)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return "", fmt.Errorf("reading attachment body: %w", err)
+	}
+	if int64(len(data)) > maxBytes {
+		return "", fmt.Errorf("attachment exceeds max size of %d bytes", maxBytes)
+	}
+
+	return fmt.Sprintf("data:%s;base64,%s", contentType, base64.StdEncoding.EncodeToString(data)), nil
+}
+
+// Create a handler factory function that routes parsed webhook messages to
+// the sinks configured for the route matching the request's source tag (the
+// path segment after the webhook secret). It only ever sees requests that
+// the caller has already matched against pathStore's current path. Matched
+// deliveries are handed off to the outbox rather than sent inline, so a sink
+// outage doesn't lose the message.
+func makeWebhookHandler(preserveMarkdown bool, sinks map[string]Sink, routes []Route, pathStore *webhookPathStore, metrics *Metrics, buffer *messageBuffer, outbox *Outbox) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Only allow POST method
 		if r.Method != http.MethodPost {
@@ -98,10 +308,10 @@ func makeWebhookHandler(preserveMarkdown bool) http.HandlerFunc {
 			return
 		}
 
-		// Get Signal configuration from environment variables
-		signalGroup := os.Getenv("SIGNAL_GROUP_ID")
-		signalPhone := os.Getenv("SIGNAL_PHONE")
-		signalAPIURL := os.Getenv("SIGNAL_API_URL")
+		metrics.IncReceived()
+
+		sourceTag := strings.TrimPrefix(r.URL.Path, "/"+pathStore.Get())
+		sourceTag = strings.Trim(sourceTag, "/")
 
 		// Read the request body
 		body, err := io.ReadAll(r.Body)
@@ -111,6 +321,20 @@ func makeWebhookHandler(preserveMarkdown bool) http.HandlerFunc {
 		}
 		defer r.Body.Close()
 
+		// Verify the HMAC signature if a webhook secret is configured
+		if webhookSecret := os.Getenv("WEBHOOK_SECRET"); webhookSecret != "" {
+			signatureHeader := os.Getenv("WEBHOOK_SIGNATURE_HEADER")
+			if signatureHeader == "" {
+				signatureHeader = "X-Hub-Signature-256"
+			}
+
+			if !verifyWebhookSignature(body, r.Header.Get(signatureHeader), webhookSecret) {
+				metrics.IncHMACRejected()
+				http.Error(w, "Invalid signature", http.StatusUnauthorized)
+				return
+			}
+		}
+
 		// Send 200 response immediately after successful read
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("Webhook received"))
@@ -120,6 +344,8 @@ func makeWebhookHandler(preserveMarkdown bool) http.HandlerFunc {
 		var discordPayload DiscordWebhook
 		if err := json.Unmarshal(body, &discordPayload); err == nil && discordPayload.Content != "" {
 			message = discordPayload.Content
+		} else if err == nil && len(discordPayload.Embeds) > 0 {
+			message = renderEmbeds(discordPayload.Embeds, preserveMarkdown)
 		} else {
 			log.Printf("Invalid webhook format")
 			return
@@ -138,72 +364,136 @@ func makeWebhookHandler(preserveMarkdown bool) http.HandlerFunc {
 			finalMessage = *plaintextMessagePtr
 		}
 
-		// Prepare Signal API payload
-		signalPayload := SignalAPIPayload{
-			Number:     signalPhone,
-			Message:    finalMessage,
-			Recipients: []string{signalGroup},
-		}
-
-		// Ensure URL has a scheme
-		apiURL := signalAPIURL
-		if !strings.HasPrefix(apiURL, "http://") && !strings.HasPrefix(apiURL, "https://") {
-			apiURL = "http://" + apiURL
-		}
+		// Fetch any embed images/thumbnails or attachments as base64 for Signal
+		var base64Attachments []string
+		if urls := attachmentURLs(discordPayload); len(urls) > 0 {
+			maxBytes := int64(defaultAttachmentMaxBytes)
+			if v := os.Getenv("ATTACHMENT_MAX_BYTES"); v != "" {
+				if parsed, err := strconv.ParseInt(v, 10, 64); err == nil {
+					maxBytes = parsed
+				}
+			}
 
-		// Create request body using json.NewEncoder
-		var buf bytes.Buffer
-		if err := json.NewEncoder(&buf).Encode(signalPayload); err != nil {
-			log.Printf("Error encoding request body: %v", err)
-			return
-		}
+			timeout := defaultAttachmentTimeout
+			if v := os.Getenv("ATTACHMENT_TIMEOUT"); v != "" {
+				if parsed, err := time.ParseDuration(v); err == nil {
+					timeout = parsed
+				}
+			}
 
-		// Create full request URL
-		fullURL := apiURL + "/v2/send"
-		log.Printf("Making request to: %s", fullURL)
+			mimeAllowlist := []string{defaultAttachmentMIMEAllowlist}
+			if v := os.Getenv("ATTACHMENT_MIME_ALLOWLIST"); v != "" {
+				mimeAllowlist = strings.Split(v, ",")
+			}
 
-		// Send POST request to Signal API
-		req, err := http.NewRequest("POST", fullURL, &buf)
-		if err != nil {
-			log.Printf("Error creating request: %v", err)
-			return
+			attachmentClient := &http.Client{Timeout: timeout}
+			for _, url := range urls {
+				dataURL, err := fetchAttachmentAsDataURL(attachmentClient, url, maxBytes, mimeAllowlist)
+				if err != nil {
+					log.Printf("Error fetching attachment %s: %v", url, err)
+					continue
+				}
+				base64Attachments = append(base64Attachments, dataURL)
+			}
 		}
-		req.Header.Set("Content-Type", "application/json")
 
-		client := &http.Client{}
-		resp, err := client.Do(req)
-		if err != nil {
-			log.Printf("Error sending Signal message: %v", err)
-			return
+		outgoing := Message{Text: finalMessage, Base64Attachments: base64Attachments}
+		buffer.Add(sourceTag, outgoing)
+
+		matched := false
+		for _, route := range routes {
+			if route.Path != sourceTag {
+				continue
+			}
+			if route.Match != nil && !route.Match.MatchString(finalMessage) {
+				continue
+			}
+			matched = true
+
+			for _, sinkName := range route.Sinks {
+				if _, ok := sinks[sinkName]; !ok {
+					log.Printf("Route %q references unknown sink %q", route.Path, sinkName)
+					continue
+				}
+				if err := outbox.Enqueue(sinkName, outgoing); err != nil {
+					log.Printf("Error queuing message for sink %q: %v", sinkName, err)
+					metrics.IncFailed()
+				}
+			}
 		}
-		defer resp.Body.Close()
 
-		if resp.StatusCode != http.StatusOK {
-			// Read and log error response body
-			respBody, _ := io.ReadAll(resp.Body)
-			log.Printf("Signal API returned non-200 status: %d, response: %s", resp.StatusCode, string(respBody))
-			return
+		if !matched {
+			log.Printf("No route matched source tag %q", sourceTag)
 		}
 	}
 }
 
 func main() {
-	// Verify required environment variables
-	requiredEnvVars := []string{"TS_HOSTNAME", "TS_AUTHKEY", "SIGNAL_PHONE", "SIGNAL_GROUP_ID", "SIGNAL_API_URL"}
+	preserveMarkdown := flag.Bool("preserve-markdown", false, "Preserve markdown in the message")
+	configPath := flag.String("config", "", "Path to a sinks/routes YAML config file (falls back to SIGNAL_* env vars if unset)")
+	flag.Parse()
+
+	requiredEnvVars := []string{"TS_HOSTNAME", "TS_AUTHKEY"}
+	if *configPath == "" {
+		requiredEnvVars = append(requiredEnvVars, "SIGNAL_PHONE", "SIGNAL_GROUP_ID", "SIGNAL_API_URL")
+	}
 	for _, envVar := range requiredEnvVars {
 		if os.Getenv(envVar) == "" {
 			log.Fatalf("%s environment variable is required", envVar)
 		}
 	}
 
-	preserveMarkdown := flag.Bool("preserve-markdown", false, "Preserve markdown in the message")
-	flag.Parse()
+	var cfg *Config
+	if *configPath != "" {
+		var err error
+		cfg, err = LoadConfig(*configPath)
+		if err != nil {
+			log.Fatalf("Failed to load config: %v", err)
+		}
+	} else {
+		cfg = defaultConfig()
+	}
+
+	sinks, err := BuildSinks(cfg)
+	if err != nil {
+		log.Fatalf("Failed to build sinks: %v", err)
+	}
+
+	routes, err := BuildRoutes(cfg)
+	if err != nil {
+		log.Fatalf("Failed to build routes: %v", err)
+	}
 
 	// Get or create webhook path
 	webhookPath, err := getWebhookPath()
 	if err != nil {
 		log.Fatalf("Failed to setup webhook path: %v", err)
 	}
+	pathStore := newWebhookPathStore(webhookPath)
+
+	metrics := &Metrics{}
+	buffer := newMessageBuffer(50)
+
+	outboxPath, err := outboxFilePath()
+	if err != nil {
+		log.Fatalf("Failed to setup outbox path: %v", err)
+	}
+	outbox := NewOutbox(outboxPath)
+	if err := outbox.Load(); err != nil {
+		log.Fatalf("Failed to load outbox: %v", err)
+	}
+	metrics.outboxDepth = outbox.Depth
+
+	outboxMaxAttempts := defaultOutboxMaxAttempts
+	if v := os.Getenv("OUTBOX_MAX_ATTEMPTS"); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil && parsed > 0 {
+			outboxMaxAttempts = parsed
+		}
+	}
+
+	outboxCtx, stopOutbox := context.WithCancel(context.Background())
+	defer stopOutbox()
+	go outbox.Run(outboxCtx, sinks, metrics, outboxMaxAttempts)
 
 	// Create a new tsnet Server
 	s := &tsnet.Server{
@@ -211,20 +501,64 @@ func main() {
 	}
 	defer s.Close()
 
-	// Start the Funnel listener
-	ln, err := s.ListenFunnel("tcp", ":443")
+	// Start the public Funnel listener, serving only the secret webhook path.
+	// The path is read from pathStore on every request so /rotate-secret can
+	// change it without a restart.
+	funnelLn, err := s.ListenFunnel("tcp", ":443")
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer ln.Close()
-
-	// Set up the webhook handler
-	mux := http.NewServeMux()
-	mux.HandleFunc("/"+webhookPath, makeWebhookHandler(*preserveMarkdown))
+	defer funnelLn.Close()
+
+	webhookHandler := makeWebhookHandler(*preserveMarkdown, sinks, routes, pathStore, metrics, buffer, outbox)
+	publicMux := http.NewServeMux()
+	publicMux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		currentPath := "/" + pathStore.Get()
+		if r.URL.Path != currentPath && !strings.HasPrefix(r.URL.Path, currentPath+"/") {
+			http.NotFound(w, r)
+			return
+		}
+		webhookHandler(w, r)
+	})
+	publicServer := &http.Server{Handler: publicMux}
 
-	log.Printf("Server starting with Tailscale Funnel enabled")
-	log.Printf("Listening on: https://%v/%s", s.CertDomains()[0], webhookPath)
-	if err := http.Serve(ln, mux); err != nil {
+	// Start the tailnet-only listener carrying the admin surface.
+	adminLn, err := s.Listen("tcp", ":80")
+	if err != nil {
 		log.Fatal(err)
 	}
+	defer adminLn.Close()
+
+	adminServer := &http.Server{Handler: makeAdminMux(metrics, pathStore, buffer, sinks, routes)}
+
+	errCh := make(chan error, 2)
+	go func() {
+		log.Printf("Server starting with Tailscale Funnel enabled")
+		log.Printf("Listening on: https://%v/%s", s.CertDomains()[0], pathStore.Get())
+		errCh <- publicServer.Serve(funnelLn)
+	}()
+	go func() {
+		log.Printf("Admin server listening on tailnet :80 (healthz, metrics, rotate-secret, replay)")
+		errCh <- adminServer.Serve(adminLn)
+	}()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case sig := <-sigCh:
+		log.Printf("Received %s, shutting down", sig)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := publicServer.Shutdown(ctx); err != nil {
+			log.Printf("Error shutting down public server: %v", err)
+		}
+		if err := adminServer.Shutdown(ctx); err != nil {
+			log.Printf("Error shutting down admin server: %v", err)
+		}
+	case err := <-errCh:
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}
 }
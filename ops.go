@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// Metrics holds the counters exposed on the tailnet-only /metrics endpoint.
+type Metrics struct {
+	received     int64
+	forwarded    int64
+	failed       int64
+	hmacRejected int64
+
+	// outboxDepth, if set, reports the current retry queue depth.
+	outboxDepth func() int
+}
+
+func (m *Metrics) IncReceived()     { atomic.AddInt64(&m.received, 1) }
+func (m *Metrics) IncForwarded()    { atomic.AddInt64(&m.forwarded, 1) }
+func (m *Metrics) IncFailed()       { atomic.AddInt64(&m.failed, 1) }
+func (m *Metrics) IncHMACRejected() { atomic.AddInt64(&m.hmacRejected, 1) }
+
+// WriteTo renders the counters in Prometheus text exposition format.
+func (m *Metrics) WriteTo(w io.Writer) {
+	fmt.Fprintf(w, "# HELP puzzmo2signal_messages_received_total Webhooks received.\n")
+	fmt.Fprintf(w, "# TYPE puzzmo2signal_messages_received_total counter\n")
+	fmt.Fprintf(w, "puzzmo2signal_messages_received_total %d\n", atomic.LoadInt64(&m.received))
+
+	fmt.Fprintf(w, "# HELP puzzmo2signal_messages_forwarded_total Messages forwarded to a sink.\n")
+	fmt.Fprintf(w, "# TYPE puzzmo2signal_messages_forwarded_total counter\n")
+	fmt.Fprintf(w, "puzzmo2signal_messages_forwarded_total %d\n", atomic.LoadInt64(&m.forwarded))
+
+	fmt.Fprintf(w, "# HELP puzzmo2signal_messages_failed_total Deliveries that could not be queued or were given up on after the maximum retry attempts.\n")
+	fmt.Fprintf(w, "# TYPE puzzmo2signal_messages_failed_total counter\n")
+	fmt.Fprintf(w, "puzzmo2signal_messages_failed_total %d\n", atomic.LoadInt64(&m.failed))
+
+	fmt.Fprintf(w, "# HELP puzzmo2signal_hmac_rejected_total Requests rejected for a bad HMAC signature.\n")
+	fmt.Fprintf(w, "# TYPE puzzmo2signal_hmac_rejected_total counter\n")
+	fmt.Fprintf(w, "puzzmo2signal_hmac_rejected_total %d\n", atomic.LoadInt64(&m.hmacRejected))
+
+	if m.outboxDepth != nil {
+		fmt.Fprintf(w, "# HELP puzzmo2signal_outbox_depth Messages currently queued for retry.\n")
+		fmt.Fprintf(w, "# TYPE puzzmo2signal_outbox_depth gauge\n")
+		fmt.Fprintf(w, "puzzmo2signal_outbox_depth %d\n", m.outboxDepth())
+	}
+}
+
+// webhookPathStore holds the current webhook path so /rotate-secret can
+// change it without restarting the process.
+type webhookPathStore struct {
+	mu   sync.RWMutex
+	path string
+}
+
+func newWebhookPathStore(path string) *webhookPathStore {
+	return &webhookPathStore{path: path}
+}
+
+func (s *webhookPathStore) Get() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.path
+}
+
+// Rotate generates a new webhook path, persists it to webhook_config.json,
+// and swaps it in atomically.
+func (s *webhookPathStore) Rotate() (string, error) {
+	newPath, err := generateSecurePath()
+	if err != nil {
+		return "", err
+	}
+	if err := saveWebhookPath(newPath); err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	s.path = newPath
+	s.mu.Unlock()
+
+	return newPath, nil
+}
+
+// bufferedMessage is one entry in the replay buffer: a parsed Message plus
+// the source tag its route was matched on.
+type bufferedMessage struct {
+	sourceTag string
+	msg       Message
+}
+
+// messageBuffer keeps the last N parsed messages so /replay can re-send them.
+type messageBuffer struct {
+	mu  sync.Mutex
+	buf []bufferedMessage
+	max int
+}
+
+func newMessageBuffer(max int) *messageBuffer {
+	return &messageBuffer{max: max}
+}
+
+func (b *messageBuffer) Add(sourceTag string, msg Message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.buf = append(b.buf, bufferedMessage{sourceTag: sourceTag, msg: msg})
+	if len(b.buf) > b.max {
+		b.buf = b.buf[len(b.buf)-b.max:]
+	}
+}
+
+// Last returns (a copy of) the most recent n buffered messages, oldest first.
+func (b *messageBuffer) Last(n int) []bufferedMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if n > len(b.buf) {
+		n = len(b.buf)
+	}
+	out := make([]bufferedMessage, n)
+	copy(out, b.buf[len(b.buf)-n:])
+	return out
+}
+
+// makeAdminMux builds the tailnet-only admin surface: health check, metrics,
+// webhook secret rotation, and replay of recently buffered messages.
+func makeAdminMux(metrics *Metrics, pathStore *webhookPathStore, buffer *messageBuffer, sinks map[string]Sink, routes []Route) *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	})
+
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		metrics.WriteTo(w)
+	})
+
+	mux.HandleFunc("/rotate-secret", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		newPath, err := pathStore.Rotate()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to rotate webhook secret: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		fmt.Fprintf(w, "New webhook path: /%s\n", newPath)
+	})
+
+	mux.HandleFunc("/replay", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		n := 1
+		if v := r.URL.Query().Get("n"); v != "" {
+			if parsed, err := strconv.Atoi(v); err == nil && parsed > 0 {
+				n = parsed
+			}
+		}
+
+		replayed := 0
+		for _, buffered := range buffer.Last(n) {
+			for _, route := range routes {
+				if route.Path != buffered.sourceTag {
+					continue
+				}
+				if route.Match != nil && !route.Match.MatchString(buffered.msg.Text) {
+					continue
+				}
+				for _, sinkName := range route.Sinks {
+					sink, ok := sinks[sinkName]
+					if !ok {
+						continue
+					}
+					if err := sink.Send(context.Background(), buffered.msg); err != nil {
+						log.Printf("Error replaying to sink %q: %v", sinkName, err)
+						continue
+					}
+					replayed++
+				}
+			}
+		}
+
+		fmt.Fprintf(w, "Replayed %d delivery attempt(s)\n", replayed)
+	})
+
+	return mux
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultOutboxMaxAttempts = 20
+const outboxDrainInterval = 5 * time.Second
+const outboxMaxBackoff = 6 * time.Hour
+
+// outboxBackoffSchedule gives the wait before each successive retry; once
+// exhausted, retries are spaced outboxMaxBackoff apart.
+var outboxBackoffSchedule = []time.Duration{
+	5 * time.Second,
+	30 * time.Second,
+	2 * time.Minute,
+	10 * time.Minute,
+	time.Hour,
+}
+
+func outboxBackoff(attempts int) time.Duration {
+	if attempts <= 0 {
+		return 0
+	}
+	if idx := attempts - 1; idx < len(outboxBackoffSchedule) {
+		return outboxBackoffSchedule[idx]
+	}
+	return outboxMaxBackoff
+}
+
+var outboxIDCounter uint64
+
+func generateOutboxID() string {
+	return fmt.Sprintf("%d-%d", time.Now().UnixNano(), atomic.AddUint64(&outboxIDCounter, 1))
+}
+
+// OutboxEntry is one pending delivery: a Message bound for a named sink,
+// along with its retry state.
+type OutboxEntry struct {
+	ID        string    `json:"id"`
+	SinkName  string    `json:"sink"`
+	Message   Message   `json:"message"`
+	Attempts  int       `json:"attempts"`
+	NextRetry time.Time `json:"next_retry"`
+}
+
+// Outbox is a durable, disk-backed queue of pending sink deliveries. Entries
+// are appended to an ndjson file as they're enqueued, and the file is
+// rewritten to match the in-memory queue whenever an entry is resolved.
+type Outbox struct {
+	mu      sync.Mutex
+	path    string
+	entries []*OutboxEntry
+}
+
+// NewOutbox returns an Outbox backed by the ndjson file at path. Call Load
+// to resume any entries left over from a previous run.
+func NewOutbox(path string) *Outbox {
+	return &Outbox{path: path}
+}
+
+// outboxFilePath returns the path to the outbox's ndjson file, creating its
+// parent directory if needed.
+func outboxFilePath() (string, error) {
+	userConfigDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user config directory: %v", err)
+	}
+
+	configDir := filepath.Join(userConfigDir, "puzzmo2signal")
+	if err := os.MkdirAll(configDir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create config directory: %v", err)
+	}
+
+	return filepath.Join(configDir, "outbox.ndjson"), nil
+}
+
+// Load reads any entries left over from a previous run. A missing file
+// means there's nothing to resume.
+func (o *Outbox) Load() error {
+	data, err := os.ReadFile(o.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading outbox file: %w", err)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry OutboxEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			log.Printf("Outbox: skipping corrupt entry: %v", err)
+			continue
+		}
+		o.entries = append(o.entries, &entry)
+	}
+
+	return nil
+}
+
+// Enqueue durably queues msg for delivery to sinkName, to be picked up by
+// the next drain.
+func (o *Outbox) Enqueue(sinkName string, msg Message) error {
+	entry := &OutboxEntry{
+		ID:        generateOutboxID(),
+		SinkName:  sinkName,
+		Message:   msg,
+		NextRetry: time.Now(),
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.entries = append(o.entries, entry)
+	return o.appendLocked(entry)
+}
+
+func (o *Outbox) appendLocked(entry *OutboxEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("encoding outbox entry: %w", err)
+	}
+
+	f, err := os.OpenFile(o.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("opening outbox file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("writing outbox entry: %w", err)
+	}
+	return nil
+}
+
+// compactLocked rewrites the outbox file to match the in-memory queue,
+// dropping entries that have since been resolved.
+func (o *Outbox) compactLocked() error {
+	var buf bytes.Buffer
+	for _, entry := range o.entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("encoding outbox entry: %w", err)
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	return os.WriteFile(o.path, buf.Bytes(), 0600)
+}
+
+func (o *Outbox) removeAndCompact(id string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for i, entry := range o.entries {
+		if entry.ID == id {
+			o.entries = append(o.entries[:i], o.entries[i+1:]...)
+			break
+		}
+	}
+
+	if err := o.compactLocked(); err != nil {
+		log.Printf("Outbox: failed to compact after removing entry: %v", err)
+	}
+}
+
+// Depth returns the number of entries currently queued, for the /metrics
+// endpoint.
+func (o *Outbox) Depth() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.entries)
+}
+
+// Run drains due entries every outboxDrainInterval until ctx is canceled.
+func (o *Outbox) Run(ctx context.Context, sinks map[string]Sink, metrics *Metrics, maxAttempts int) {
+	ticker := time.NewTicker(outboxDrainInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			o.drain(sinks, metrics, maxAttempts)
+		}
+	}
+}
+
+func (o *Outbox) dueEntries() []*OutboxEntry {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	now := time.Now()
+	var due []*OutboxEntry
+	for _, entry := range o.entries {
+		if !entry.NextRetry.After(now) {
+			due = append(due, entry)
+		}
+	}
+	return due
+}
+
+func (o *Outbox) drain(sinks map[string]Sink, metrics *Metrics, maxAttempts int) {
+	for _, entry := range o.dueEntries() {
+		sink, ok := sinks[entry.SinkName]
+		if !ok {
+			log.Printf("Outbox: dropping entry for unknown sink %q", entry.SinkName)
+			o.removeAndCompact(entry.ID)
+			continue
+		}
+
+		if err := sink.Send(context.Background(), entry.Message); err != nil {
+			entry.Attempts++
+			if entry.Attempts >= maxAttempts {
+				log.Printf("Outbox: giving up on sink %q after %d attempts: %v", entry.SinkName, entry.Attempts, err)
+				metrics.IncFailed()
+				o.removeAndCompact(entry.ID)
+				continue
+			}
+
+			entry.NextRetry = time.Now().Add(outboxBackoff(entry.Attempts))
+			log.Printf("Outbox: attempt %d for sink %q failed, retrying at %s: %v",
+				entry.Attempts, entry.SinkName, entry.NextRetry.Format(time.RFC3339), err)
+
+			o.mu.Lock()
+			err := o.compactLocked()
+			o.mu.Unlock()
+			if err != nil {
+				log.Printf("Outbox: failed to persist retry state: %v", err)
+			}
+			continue
+		}
+
+		metrics.IncForwarded()
+		o.removeAndCompact(entry.ID)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Message is the normalized notification a Sink forwards to its destination.
+type Message struct {
+	Text              string   `json:"text"`
+	Base64Attachments []string `json:"base64_attachments,omitempty"`
+}
+
+// Sink delivers a Message to one destination (Signal, Slack, Matrix, ...).
+type Sink interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+func httpClientOrDefault(client *http.Client) *http.Client {
+	if client != nil {
+		return client
+	}
+	return http.DefaultClient
+}
+
+// SignalSink delivers messages via signal-cli-rest-api's /v2/send endpoint.
+type SignalSink struct {
+	APIURL     string
+	Phone      string
+	GroupID    string
+	HTTPClient *http.Client
+}
+
+func (s *SignalSink) Send(ctx context.Context, msg Message) error {
+	apiURL := s.APIURL
+	if !strings.HasPrefix(apiURL, "http://") && !strings.HasPrefix(apiURL, "https://") {
+		apiURL = "http://" + apiURL
+	}
+
+	payload := SignalAPIPayload{
+		Number:            s.Phone,
+		Message:           msg.Text,
+		Recipients:        []string{s.GroupID},
+		Base64Attachments: msg.Base64Attachments,
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(payload); err != nil {
+		return fmt.Errorf("encoding signal payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL+"/v2/send", &buf)
+	if err != nil {
+		return fmt.Errorf("creating signal request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClientOrDefault(s.HTTPClient).Do(req)
+	if err != nil {
+		return fmt.Errorf("sending signal message: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("signal API returned non-200 status: %d, response: %s", resp.StatusCode, respBody)
+	}
+	return nil
+}
+
+// SlackSink delivers messages via a Slack incoming webhook.
+type SlackSink struct {
+	WebhookURL string
+	HTTPClient *http.Client
+}
+
+type slackPayload struct {
+	Text string `json:"text"`
+}
+
+func (s *SlackSink) Send(ctx context.Context, msg Message) error {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(slackPayload{Text: msg.Text}); err != nil {
+		return fmt.Errorf("encoding slack payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.WebhookURL, &buf)
+	if err != nil {
+		return fmt.Errorf("creating slack request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClientOrDefault(s.HTTPClient).Do(req)
+	if err != nil {
+		return fmt.Errorf("sending slack message: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("slack webhook returned non-200 status: %d, response: %s", resp.StatusCode, respBody)
+	}
+	return nil
+}
+
+// MatrixSink delivers messages as m.text events in a Matrix room.
+type MatrixSink struct {
+	HomeserverURL string
+	RoomID        string
+	AccessToken   string
+	HTTPClient    *http.Client
+}
+
+type matrixMessageEvent struct {
+	MsgType string `json:"msgtype"`
+	Body    string `json:"body"`
+}
+
+func (m *MatrixSink) Send(ctx context.Context, msg Message) error {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(matrixMessageEvent{MsgType: "m.text", Body: msg.Text}); err != nil {
+		return fmt.Errorf("encoding matrix payload: %w", err)
+	}
+
+	// The send endpoint is idempotent per transaction ID; a nanosecond
+	// timestamp is a simple unique-enough value for a low-volume bridge.
+	txnID := fmt.Sprintf("%d", time.Now().UnixNano())
+	sendURL := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s",
+		strings.TrimSuffix(m.HomeserverURL, "/"), url.PathEscape(m.RoomID), txnID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, sendURL, &buf)
+	if err != nil {
+		return fmt.Errorf("creating matrix request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+m.AccessToken)
+
+	resp, err := httpClientOrDefault(m.HTTPClient).Do(req)
+	if err != nil {
+		return fmt.Errorf("sending matrix message: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("matrix API returned non-200 status: %d, response: %s", resp.StatusCode, respBody)
+	}
+	return nil
+}
+
+// WebhookSink POSTs a Go text/template-rendered body to an arbitrary URL.
+type WebhookSink struct {
+	URL        string
+	Template   *template.Template
+	HTTPClient *http.Client
+}
+
+func (w *WebhookSink) Send(ctx context.Context, msg Message) error {
+	var buf bytes.Buffer
+	if err := w.Template.Execute(&buf, msg); err != nil {
+		return fmt.Errorf("executing webhook template: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, &buf)
+	if err != nil {
+		return fmt.Errorf("creating webhook request: %w", err)
+	}
+
+	resp, err := httpClientOrDefault(w.HTTPClient).Do(req)
+	if err != nil {
+		return fmt.Errorf("sending webhook request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("webhook sink returned non-2xx status: %d, response: %s", resp.StatusCode, respBody)
+	}
+	return nil
+}